@@ -1,181 +1,186 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/bradfitz/issuemirror"
 	"github.com/google/go-github/github"
+	"github.com/parkr/jekyll-issue-mirror/githubgql"
 	jekyllissues "github.com/parkr/jekyll-issue-mirror/issues"
+	"github.com/parkr/jekyll-issue-mirror/mirror"
+	"github.com/parkr/jekyll-issue-mirror/ratelimit"
+	"github.com/parkr/jekyll-issue-mirror/server"
+	"github.com/parkr/jekyll-issue-mirror/storage"
+	"github.com/shurcooL/githubv4"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	owner = "jekyll"
-	repo  = "jekyll"
-)
+const maxConcurrentRepos = 4
 
-type debugLogger struct {
-	mu       sync.Mutex
-	messages []string
-}
+var (
+	configPath   = flag.String("config", "", "path to a YAML or JSON config file listing repos to mirror (defaults to mirroring jekyll/jekyll alone)")
+	useGraphQL   = flag.Bool("graphql", false, "fetch issues and comments via the GraphQL API instead of one REST request per comment page")
+	concurrency  = flag.Int("concurrency", 0, "issues to process at once per repo; entries may override this in their config (0 uses the package default)")
+	httpAddr     = flag.String("http", "", "if set, after the initial sync, serve the first repo's mirrored issues and accept webhooks on this address (e.g. :8080) instead of exiting")
+	pollInterval = flag.Duration("poll-interval", 5*time.Minute, "how often to re-sync while serving -http")
+)
 
-func (d *debugLogger) nowPrefix() string {
-	return time.Now().Format("2006/01/02 15:04:05 ")
+// defaultConfig preserves this binary's original behavior when no -config
+// is given: mirror jekyll/jekyll alone, into jekyllissues' usual cache
+// folder.
+func defaultConfig() (*mirror.Config, error) {
+	root, err := jekyllissues.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opening issue cache folder: %v", err)
+	}
+	return &mirror.Config{
+		Repos: []mirror.Entry{
+			{Owner: "jekyll", Repo: "jekyll", Root: string(root), TokenEnv: "GITHUB_TOKEN"},
+		},
+	}, nil
 }
 
-func (d *debugLogger) Println(args ...interface{}) {
-	d.Printf("%s", fmt.Sprintln(args...))
-}
+func mirrorOne(ctx context.Context, entry mirror.Entry, metrics *mirror.Metrics) error {
+	logger := &mirror.Logger{}
+	var err error
+	if *useGraphQL {
+		httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: os.Getenv(entry.TokenEnv)},
+		))
+		httpClient.Transport = &ratelimit.Transport{
+			Base: httpClient.Transport,
+			Hooks: ratelimit.Hooks{
+				OnRequest:   metrics.IncAPICalls,
+				OnRateLimit: metrics.SetRateLimitRemaining,
+			},
+		}
+		if err := os.MkdirAll(entry.Root, 0755); err != nil {
+			return fmt.Errorf("creating root %s: %v", entry.Root, err)
+		}
+		root := issuemirror.Root(entry.Root)
+		store, storeErr := storage.New(entry.Storage, root, entry.Root)
+		if storeErr != nil {
+			return fmt.Errorf("setting up storage: %v", storeErr)
+		}
+		fetcher := &githubgql.Fetcher{
+			Client:     githubv4.NewClient(httpClient),
+			Store:      store,
+			Owner:      entry.Owner,
+			Repo:       entry.Repo,
+			Logger:     logger,
+			RESTClient: github.NewClient(httpClient),
+		}
+		err = fetcher.Fetch(ctx)
+	} else {
+		err = mirror.Mirror(ctx, entry, logger, metrics)
+	}
 
-func (d *debugLogger) Printf(format string, args ...interface{}) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	d.messages = append(d.messages, fmt.Sprintf(d.nowPrefix()+format, args...))
+	// Flush this repo's log as one block so concurrent repos' output
+	// doesn't interleave line-by-line.
+	fmt.Fprintf(os.Stderr, "=== %s/%s ===\n%s\n", entry.Owner, entry.Repo, logger.String())
+	if err != nil {
+		return fmt.Errorf("%s/%s: %v", entry.Owner, entry.Repo, err)
+	}
+	return nil
 }
 
-func (d *debugLogger) String() string {
-	return strings.Join(d.messages, "\n")
-}
+func main() {
+	flag.Parse()
 
-func (d *debugLogger) Fatalf(format string, args ...interface{}) {
-	d.Printf(format, args...)
-	fmt.Fprintln(os.Stderr, d.String())
-	os.Exit(1)
-}
+	var cfg *mirror.Config
+	if *configPath == "" {
+		c, err := defaultConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg = c
+	} else {
+		c, err := mirror.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg = c
+	}
 
-func (d *debugLogger) Fatalln(args ...interface{}) {
-	d.Fatalf("%s", fmt.Sprintln(args...))
-}
+	var metrics *mirror.Metrics
+	if *httpAddr != "" {
+		metrics = &mirror.Metrics{}
+	}
 
-var debug = debugLogger{}
+	ctx := context.Background()
+	if err := mirrorAll(ctx, cfg.Repos, metrics); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-func writeIssues(client *github.Client, root issuemirror.Root, issues []*github.Issue) error {
-	g, _ := errgroup.WithContext(context.Background())
-	debug.Printf("processing %d issues", len(issues))
-	for _, issue := range issues {
-		issueVal := *issue
-		num := *issueVal.Number
-		g.Go(func() error {
-			start := time.Now()
-			debug.Printf("started processing %d at %v", num, start)
-			// Write issue
-			issueFile := root.IssueJSONFile(num)
-			err := os.MkdirAll(filepath.Dir(issueFile), 0755)
-			if err != nil {
-				return err
-			}
-			issueJSON, err := json.Marshal(issueVal)
-			if err != nil {
-				return err
-			}
-			err = ioutil.WriteFile(issueFile, issueJSON, 0644)
-			if err != nil {
-				return err
-			}
+	if *httpAddr == "" {
+		return
+	}
 
-			// Are there comments?
-			if *issue.Comments <= 0 {
-				return nil
-			}
+	go pollForever(ctx, cfg.Repos, metrics)
 
-			// OK, now handle the comments.
-			commentsDir := root.IssueCommentsDir(num)
-			err = os.MkdirAll(commentsDir, 0755)
-			if err != nil {
-				return err
-			}
-			opt := &github.IssueListCommentsOptions{
-				Sort:      "created",
-				Direction: "asc",
-				ListOptions: github.ListOptions{
-					Page:    0,
-					PerPage: 100,
-				},
-			}
-			for {
-				debug.Printf("client.Issues.ListComments(%s, %s, %d, %s)", owner, repo, num, github.Stringify(opt))
-				comments, resp, err := client.Issues.ListComments(context.Background(), owner, repo, num, opt)
-				if err != nil {
-					debug.Fatalf("listing comments for issue=%d; page %d: %v", num, opt.ListOptions.Page, err)
-				}
-				err = writeComments(root, issueVal, comments)
-				if err != nil {
-					debug.Fatalf("writing comments for issue=%d; page %d: %v", num, opt.ListOptions.Page, err)
-				}
-				if resp.NextPage == 0 {
-					break
-				}
-				opt.ListOptions.Page = resp.NextPage
-			}
-			debug.Printf("finished processing %d in %s", num, time.Since(start))
-			return nil
-		})
+	webhookRoot := issuemirror.Root(cfg.Repos[0].Root)
+	webhookStore, err := storage.New(cfg.Repos[0].Storage, webhookRoot, cfg.Repos[0].Root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("setting up storage for webhooks: %v", err))
+		os.Exit(1)
+	}
+	srv := &server.Server{
+		Root:    webhookRoot,
+		Store:   webhookStore,
+		Metrics: metrics,
+	}
+	if secret := os.Getenv("GITHUB_WEBHOOK_SECRET"); secret != "" {
+		srv.WebhookSecret = secret
+	}
+	fmt.Fprintf(os.Stderr, "serving %s/%s on %s\n", cfg.Repos[0].Owner, cfg.Repos[0].Repo, *httpAddr)
+	if err := http.ListenAndServe(*httpAddr, srv.Handler()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	return g.Wait()
 }
 
-func writeComments(root issuemirror.Root, issue github.Issue, comments []*github.IssueComment) error {
-	g, _ := errgroup.WithContext(context.Background())
-	debug.Printf("processing %d comments for issue=%d", len(comments), *issue.Number)
-	for _, comment := range comments {
-		commentVal := *comment
+// mirrorAll syncs every entry in repos concurrently, bounded by
+// maxConcurrentRepos, and waits for them all to finish.
+func mirrorAll(ctx context.Context, repos []mirror.Entry, metrics *mirror.Metrics) error {
+	g, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, maxConcurrentRepos)
+	for _, entry := range repos {
+		entry := entry
+		if entry.Concurrency <= 0 {
+			entry.Concurrency = *concurrency
+		}
 		g.Go(func() error {
-			commentFile := root.IssueCommentFile(*issue.Number, *commentVal.ID)
-			commentJSON, err := json.Marshal(commentVal)
-			if err != nil {
-				return err
-			}
-			return ioutil.WriteFile(commentFile, commentJSON, 0644)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return mirrorOne(ctx, entry, metrics)
 		})
 	}
 	return g.Wait()
 }
 
-func main() {
-	root, err := jekyllissues.Open()
-	if err != nil {
-		debug.Fatalln("error opening issue cache folder", err)
-	}
-
-	client := github.NewClient(oauth2.NewClient(
-		oauth2.NoContext,
-		oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")},
-		),
-	))
-	opt := &github.IssueListByRepoOptions{
-		State:     "open",
-		Sort:      "created",
-		Direction: "asc",
-		ListOptions: github.ListOptions{
-			Page:    0,
-			PerPage: 100,
-		},
-	}
-
+// pollForever re-syncs repos every -poll-interval until ctx is done,
+// logging errors instead of exiting so a webhook-fed server stays up
+// even if one poll fails.
+func pollForever(ctx context.Context, repos []mirror.Entry, metrics *mirror.Metrics) {
+	ticker := time.NewTicker(*pollInterval)
+	defer ticker.Stop()
 	for {
-		debug.Printf("client.Issues.ListByRepo(%s, %s, %s)", owner, repo, github.Stringify(opt))
-		issues, resp, err := client.Issues.ListByRepo(context.Background(), owner, repo, opt)
-		if err != nil {
-			debug.Fatalln("listing issues; page", opt.ListOptions.Page, err)
-		}
-		err = writeIssues(client, root, issues)
-		if err != nil {
-			debug.Fatalln("writing issues; page", opt.ListOptions.Page, err)
-		}
-		if resp.NextPage == 0 {
-			debug.Println("no more pages")
-			break
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := mirrorAll(ctx, repos, metrics); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
 		}
-		opt.ListOptions.Page = resp.NextPage
 	}
 }
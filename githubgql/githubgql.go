@@ -0,0 +1,326 @@
+// Package githubgql fetches issues and their comments via the GitHub
+// GraphQL API instead of one REST request per issue per comment page.
+//
+// A single query pulls a page of issues with their first 100 comments
+// inlined. Issues whose comments didn't fit in that first page are
+// revisited in a second pass, paginating only those issues' comments by
+// their stored end-cursor, until every issue's comments are exhausted.
+// GraphQL's Issues connection never returns pull requests, so a second
+// query walks the repository's pull requests to find which numbers need
+// the REST-only PR detail chunk0-2 added.
+package githubgql
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/jekyll-issue-mirror/mirror"
+	"github.com/parkr/jekyll-issue-mirror/storage"
+	"github.com/shurcooL/githubv4"
+	"golang.org/x/net/context"
+)
+
+// Logger is the subset of *log.Logger (and *mirror.Logger) that Fetcher
+// needs.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// Fetcher pulls issues and comments for a single repository via GraphQL
+// and persists them through Store. Its output aims to carry the same
+// information as the REST fetcher's (author, labels, assignees, URLs,
+// timestamps), not byte-identical JSON — the two APIs don't share a
+// schema.
+type Fetcher struct {
+	Client *githubv4.Client
+	Store  storage.Storage
+	Owner  string
+	Repo   string
+	Logger Logger
+
+	// RESTClient, if set, is used after the GraphQL pass to mirror pull
+	// request detail and issue timelines — data GitHub's GraphQL issues
+	// connection doesn't carry (it only returns issues, not pull
+	// requests), so matching Mirror's REST-driven behavior still takes
+	// REST calls for that slice of the data.
+	RESTClient *github.Client
+}
+
+func (f *Fetcher) log() Logger {
+	if f.Logger == nil {
+		return nopLogger{}
+	}
+	return f.Logger
+}
+
+type label struct {
+	Name githubv4.String
+}
+
+type user struct {
+	Login githubv4.String
+}
+
+type comment struct {
+	DatabaseID int64 `graphql:"databaseId"`
+	Author     *user
+	Body       githubv4.String
+	URL        githubv4.URI
+	CreatedAt  githubv4.DateTime
+	UpdatedAt  githubv4.DateTime
+}
+
+type issueNode struct {
+	Number    githubv4.Int
+	Title     githubv4.String
+	Body      githubv4.String
+	State     githubv4.String
+	URL       githubv4.URI
+	Author    *user
+	CreatedAt githubv4.DateTime
+	UpdatedAt githubv4.DateTime
+	ClosedAt  githubv4.DateTime
+	Labels    struct {
+		Nodes []label
+	} `graphql:"labels(first: 100)"`
+	Assignees struct {
+		Nodes []user
+	} `graphql:"assignees(first: 100)"`
+	Comments struct {
+		PageInfo struct {
+			HasNextPage githubv4.Boolean
+			EndCursor   githubv4.String
+		}
+		Nodes []comment
+	} `graphql:"comments(first: 100)"`
+}
+
+type issuesQuery struct {
+	Repository struct {
+		Issues struct {
+			PageInfo struct {
+				HasNextPage githubv4.Boolean
+				EndCursor   githubv4.String
+			}
+			Nodes []issueNode
+		} `graphql:"issues(first: 100, after: $issuesCursor, orderBy: {field: CREATED_AT, direction: ASC}, filterBy: {since: $since})"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+type issueCommentsQuery struct {
+	Repository struct {
+		Issue struct {
+			Comments struct {
+				PageInfo struct {
+					HasNextPage githubv4.Boolean
+					EndCursor   githubv4.String
+				}
+				Nodes []comment
+			} `graphql:"comments(first: 100, after: $commentsCursor)"`
+		} `graphql:"issue(number: $issueNumber)"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// pullRequestNode is deliberately thin: it's only used to find which
+// issue numbers are actually pull requests, and when they last changed.
+// The PR detail itself — reviews, review comments, commits, requested
+// reviewers — comes from mirror.MirrorPullRequestExtras over REST.
+type pullRequestNode struct {
+	Number    githubv4.Int
+	UpdatedAt githubv4.DateTime
+}
+
+type pullRequestsQuery struct {
+	Repository struct {
+		PullRequests struct {
+			PageInfo struct {
+				HasNextPage githubv4.Boolean
+				EndCursor   githubv4.String
+			}
+			Nodes []pullRequestNode
+		} `graphql:"pullRequests(first: 100, after: $pullsCursor, orderBy: {field: CREATED_AT, direction: ASC}, states: [OPEN, CLOSED, MERGED])"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// Fetch walks every issue in the repository updated since the last
+// successful run, writing each issue and its comments to f.Store. If
+// f.RESTClient is set, it also mirrors pull request detail (for numbers
+// the pull requests connection reports) and issue timelines (for every
+// issue and pull request touched), the same as Mirror's REST loop.
+func (f *Fetcher) Fetch(ctx context.Context) error {
+	syncStart := time.Now()
+	since := mirror.LoadState(f.Store)
+	var sinceVar *githubv4.DateTime
+	if !since.IsZero() {
+		sinceVar = &githubv4.DateTime{Time: since}
+	}
+
+	numbers, pending, err := f.fetchIssues(ctx, sinceVar)
+	if err != nil {
+		return err
+	}
+	if err := f.fetchPendingComments(ctx, pending); err != nil {
+		return err
+	}
+
+	prNumbers, err := f.fetchPullRequestNumbers(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	if f.RESTClient != nil {
+		if err := f.mirrorRESTOnlyDetail(ctx, numbers, prNumbers); err != nil {
+			return err
+		}
+	}
+
+	return mirror.SaveState(f.Store, syncStart)
+}
+
+// fetchIssues pages through the repository's issues, writing each one
+// and its first page of comments, and returns every issue number seen
+// plus the end-cursor for any issue whose comments didn't fit in that
+// first page.
+func (f *Fetcher) fetchIssues(ctx context.Context, since *githubv4.DateTime) ([]int, map[int]githubv4.String, error) {
+	var numbers []int
+	pending := map[int]githubv4.String{}
+
+	vars := map[string]interface{}{
+		"owner":        githubv4.String(f.Owner),
+		"name":         githubv4.String(f.Repo),
+		"issuesCursor": (*githubv4.String)(nil),
+		"since":        since,
+	}
+	for {
+		var q issuesQuery
+		if err := f.Client.Query(ctx, &q, vars); err != nil {
+			return nil, nil, fmt.Errorf("querying issues: %v", err)
+		}
+		for _, node := range q.Repository.Issues.Nodes {
+			num := int(node.Number)
+			numbers = append(numbers, num)
+			if err := f.writeIssue(num, node); err != nil {
+				return nil, nil, err
+			}
+			if err := f.writeComments(num, node.Comments.Nodes); err != nil {
+				return nil, nil, err
+			}
+			if bool(node.Comments.PageInfo.HasNextPage) {
+				pending[num] = node.Comments.PageInfo.EndCursor
+			}
+		}
+		f.log().Printf("fetched %d issues via GraphQL", len(q.Repository.Issues.Nodes))
+		if !bool(q.Repository.Issues.PageInfo.HasNextPage) {
+			break
+		}
+		vars["issuesCursor"] = githubv4.NewString(q.Repository.Issues.PageInfo.EndCursor)
+	}
+	return numbers, pending, nil
+}
+
+// fetchPendingComments finishes paginating comments for issues whose
+// first page (fetched by fetchIssues) wasn't the last one.
+func (f *Fetcher) fetchPendingComments(ctx context.Context, pending map[int]githubv4.String) error {
+	for len(pending) > 0 {
+		for num, cursor := range pending {
+			var q issueCommentsQuery
+			commentVars := map[string]interface{}{
+				"owner":          githubv4.String(f.Owner),
+				"name":           githubv4.String(f.Repo),
+				"issueNumber":    githubv4.Int(num),
+				"commentsCursor": githubv4.NewString(cursor),
+			}
+			if err := f.Client.Query(ctx, &q, commentVars); err != nil {
+				return fmt.Errorf("querying comments for issue=%d: %v", num, err)
+			}
+			if err := f.writeComments(num, q.Repository.Issue.Comments.Nodes); err != nil {
+				return err
+			}
+			if bool(q.Repository.Issue.Comments.PageInfo.HasNextPage) {
+				pending[num] = q.Repository.Issue.Comments.PageInfo.EndCursor
+			} else {
+				delete(pending, num)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchPullRequestNumbers pages through the repository's pull requests —
+// a connection separate from issues — and returns the numbers of those
+// updated since the last sync (every one of them, if since is zero).
+func (f *Fetcher) fetchPullRequestNumbers(ctx context.Context, since time.Time) ([]int, error) {
+	var numbers []int
+	vars := map[string]interface{}{
+		"owner":       githubv4.String(f.Owner),
+		"name":        githubv4.String(f.Repo),
+		"pullsCursor": (*githubv4.String)(nil),
+	}
+	for {
+		var q pullRequestsQuery
+		if err := f.Client.Query(ctx, &q, vars); err != nil {
+			return nil, fmt.Errorf("querying pull requests: %v", err)
+		}
+		for _, node := range q.Repository.PullRequests.Nodes {
+			if !since.IsZero() && node.UpdatedAt.Before(since) {
+				continue
+			}
+			numbers = append(numbers, int(node.Number))
+		}
+		if !bool(q.Repository.PullRequests.PageInfo.HasNextPage) {
+			break
+		}
+		vars["pullsCursor"] = githubv4.NewString(q.Repository.PullRequests.PageInfo.EndCursor)
+	}
+	return numbers, nil
+}
+
+// mirrorRESTOnlyDetail mirrors, over REST, the data GraphQL doesn't
+// expose in a shape worth querying here: issue timelines for every
+// number touched, and full pull request detail for prNumbers.
+func (f *Fetcher) mirrorRESTOnlyDetail(ctx context.Context, numbers, prNumbers []int) error {
+	seen := make(map[int]bool, len(numbers)+len(prNumbers))
+	for _, num := range append(append([]int{}, numbers...), prNumbers...) {
+		if seen[num] {
+			continue
+		}
+		seen[num] = true
+		if err := mirror.MirrorIssueTimeline(ctx, f.RESTClient, f.Store, f.Owner, f.Repo, num); err != nil {
+			return fmt.Errorf("mirroring timeline for issue=%d: %v", num, err)
+		}
+	}
+
+	for _, num := range prNumbers {
+		if err := mirror.MirrorPullRequestExtras(ctx, f.RESTClient, f.Store, f.Owner, f.Repo, num); err != nil {
+			return fmt.Errorf("mirroring pull request %d: %v", num, err)
+		}
+	}
+	return nil
+}
+
+func (f *Fetcher) writeIssue(issueNumber int, node issueNode) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return f.Store.PutIssue(issueNumber, data)
+}
+
+func (f *Fetcher) writeComments(issueNumber int, comments []comment) error {
+	for _, c := range comments {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		if err := f.Store.PutComment(issueNumber, c.DatabaseID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
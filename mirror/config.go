@@ -0,0 +1,53 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/parkr/jekyll-issue-mirror/storage"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Entry describes a single repository to mirror.
+type Entry struct {
+	Owner    string `json:"owner" yaml:"owner"`
+	Repo     string `json:"repo" yaml:"repo"`
+	Root     string `json:"root" yaml:"root"`
+	TokenEnv string `json:"token_env" yaml:"token_env"`
+
+	// Concurrency bounds how many issues are processed at once. Zero
+	// means defaultConcurrency.
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+
+	// Storage picks where issues and comments are written. The zero
+	// value is the filesystem backend rooted at Root.
+	Storage storage.Config `json:"storage" yaml:"storage"`
+}
+
+// Config is the shape of a -config file: the list of repositories to
+// mirror, each with its own destination and, potentially, its own token.
+type Config struct {
+	Repos []Entry `json:"repos" yaml:"repos"`
+}
+
+// LoadConfig reads a YAML or JSON config file, picking the format by the
+// file's extension ('.json' for JSON, anything else for YAML).
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	var cfg Config
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(data, &cfg)
+	} else {
+		err = yaml.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config %s: %v", path, err)
+	}
+	return &cfg, nil
+}
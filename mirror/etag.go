@@ -0,0 +1,53 @@
+package mirror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// etagRecord captures the conditional-request metadata for a single
+// cached resource (an issue or a comment listing), so the next run can
+// ask GitHub for only what changed. It round-trips through Storage's
+// GetETag/PutETag as an opaque JSON string.
+type etagRecord struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func decodeETag(value string) etagRecord {
+	if value == "" {
+		return etagRecord{}
+	}
+	var rec etagRecord
+	if err := json.Unmarshal([]byte(value), &rec); err != nil {
+		return etagRecord{}
+	}
+	return rec
+}
+
+func encodeETag(rec etagRecord) string {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// etagFromResponse builds the etagRecord to persist from resp's headers.
+func etagFromResponse(resp *http.Response) etagRecord {
+	return etagRecord{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// applyConditionalHeaders adds If-None-Match/If-Modified-Since to req
+// based on a previously saved etagRecord.
+func applyConditionalHeaders(req *http.Request, rec etagRecord) {
+	if rec.ETag != "" {
+		req.Header.Set("If-None-Match", rec.ETag)
+	}
+	if rec.LastModified != "" {
+		req.Header.Set("If-Modified-Since", rec.LastModified)
+	}
+}
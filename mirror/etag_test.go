@@ -0,0 +1,52 @@
+package mirror
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDecodeEncodeETag(t *testing.T) {
+	if got := decodeETag(""); got != (etagRecord{}) {
+		t.Errorf("decodeETag(\"\") = %+v, want zero value", got)
+	}
+	if got := decodeETag("not json"); got != (etagRecord{}) {
+		t.Errorf("decodeETag(garbage) = %+v, want zero value", got)
+	}
+
+	rec := etagRecord{ETag: `"abc123"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	encoded := encodeETag(rec)
+	if got := decodeETag(encoded); got != rec {
+		t.Errorf("decodeETag(encodeETag(rec)) = %+v, want %+v", got, rec)
+	}
+}
+
+func TestEtagFromResponse(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("ETag", `"xyz"`)
+	resp.Header.Set("Last-Modified", "Tue, 03 Jan 2006 15:04:05 GMT")
+
+	got := etagFromResponse(resp)
+	want := etagRecord{ETag: `"xyz"`, LastModified: "Tue, 03 Jan 2006 15:04:05 GMT"}
+	if got != want {
+		t.Errorf("etagFromResponse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyConditionalHeaders(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	applyConditionalHeaders(req, etagRecord{})
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		t.Errorf("applyConditionalHeaders with an empty record set a header")
+	}
+
+	applyConditionalHeaders(req, etagRecord{ETag: `"abc"`, LastModified: "some-date"})
+	if got := req.Header.Get("If-None-Match"); got != `"abc"` {
+		t.Errorf("If-None-Match = %q, want %q", got, `"abc"`)
+	}
+	if got := req.Header.Get("If-Modified-Since"); got != "some-date" {
+		t.Errorf("If-Modified-Since = %q, want %q", got, "some-date")
+	}
+}
@@ -0,0 +1,36 @@
+package mirror
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger accumulates timestamped debug output for a single Mirror run.
+// Giving each repository its own Logger keeps concurrent repos' output
+// from interleaving; the caller decides when and where to print it.
+type Logger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *Logger) nowPrefix() string {
+	return time.Now().Format("2006/01/02 15:04:05 ")
+}
+
+func (l *Logger) Println(args ...interface{}) {
+	l.Printf("%s", fmt.Sprintln(args...))
+}
+
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(l.nowPrefix()+format, args...))
+}
+
+func (l *Logger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.messages, "\n")
+}
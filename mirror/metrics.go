@@ -0,0 +1,61 @@
+package mirror
+
+import "sync/atomic"
+
+// Metrics accumulates counters for a running Mirror so a caller (the
+// HTTP server's /metrics endpoint, for instance) can expose them. A nil
+// *Metrics is fine to pass to Mirror: every method on it is a no-op.
+type Metrics struct {
+	issuesSynced       uint64
+	apiCalls           uint64
+	rateLimitRemaining int64
+}
+
+// IncIssuesSynced records that an issue was written to storage.
+func (m *Metrics) IncIssuesSynced() {
+	if m != nil {
+		atomic.AddUint64(&m.issuesSynced, 1)
+	}
+}
+
+// IncAPICalls records a single GitHub API request.
+func (m *Metrics) IncAPICalls() {
+	if m != nil {
+		atomic.AddUint64(&m.apiCalls, 1)
+	}
+}
+
+// SetRateLimitRemaining records the X-RateLimit-Remaining value from the
+// most recent GitHub API response.
+func (m *Metrics) SetRateLimitRemaining(n int) {
+	if m != nil {
+		atomic.StoreInt64(&m.rateLimitRemaining, int64(n))
+	}
+}
+
+// IssuesSynced is the number of issues written to storage since m was
+// created.
+func (m *Metrics) IssuesSynced() uint64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&m.issuesSynced)
+}
+
+// APICalls is the number of GitHub API requests made since m was
+// created.
+func (m *Metrics) APICalls() uint64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&m.apiCalls)
+}
+
+// RateLimitRemaining is the last X-RateLimit-Remaining value GitHub
+// reported.
+func (m *Metrics) RateLimitRemaining() int64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&m.rateLimitRemaining)
+}
@@ -0,0 +1,261 @@
+// Package mirror syncs a GitHub repository's issues, pull requests, and
+// comments onto disk. It's the logic behind the mirrorjekyllissues binary,
+// pulled out into a library so a driver program can mirror several
+// repositories without one failure taking the whole process down.
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bradfitz/issuemirror"
+	"github.com/google/go-github/github"
+	"github.com/parkr/jekyll-issue-mirror/ratelimit"
+	"github.com/parkr/jekyll-issue-mirror/storage"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultConcurrency bounds how many issues we process at once when an
+// Entry doesn't specify its own Concurrency.
+const defaultConcurrency = 10
+
+// Mirror syncs entry's issues, and, for issues that are pull requests,
+// their reviews, review comments, commits, and requested reviewers, from
+// GitHub into entry's Storage backend. Errors are returned rather than
+// fatal, so a caller mirroring several entries can let the others keep
+// running. metrics may be nil if the caller doesn't need counters.
+func Mirror(ctx context.Context, entry Entry, logger *Logger, metrics *Metrics) error {
+	if err := os.MkdirAll(entry.Root, 0755); err != nil {
+		return fmt.Errorf("creating root %s: %v", entry.Root, err)
+	}
+	root := issuemirror.Root(entry.Root)
+
+	store, err := storage.New(entry.Storage, root, entry.Root)
+	if err != nil {
+		return fmt.Errorf("setting up storage: %v", err)
+	}
+
+	httpClient := oauth2.NewClient(
+		ctx,
+		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv(entry.TokenEnv)}),
+	)
+	httpClient.Transport = &ratelimit.Transport{
+		Base: httpClient.Transport,
+		Hooks: ratelimit.Hooks{
+			OnRequest:   metrics.IncAPICalls,
+			OnRateLimit: metrics.SetRateLimitRemaining,
+		},
+	}
+	client := github.NewClient(httpClient)
+
+	concurrency := entry.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	m := &repoMirror{
+		client:   client,
+		store:    store,
+		owner:    entry.Owner,
+		repo:     entry.Repo,
+		logger:   logger,
+		metrics:  metrics,
+		inFlight: make(chan struct{}, concurrency),
+	}
+
+	// Capture the sync start time before we ask GitHub for anything, so
+	// that anything updated mid-run gets picked up on the next poll
+	// rather than falling in the gap.
+	syncStart := time.Now()
+	state := loadState(store)
+
+	opt := &github.IssueListByRepoOptions{
+		State:     "all",
+		Sort:      "created",
+		Direction: "asc",
+		Since:     state.Since,
+		ListOptions: github.ListOptions{
+			Page:    0,
+			PerPage: 100,
+		},
+	}
+
+	for {
+		logger.Printf("client.Issues.ListByRepo(%s, %s, %s)", entry.Owner, entry.Repo, github.Stringify(opt))
+		issues, resp, err := client.Issues.ListByRepo(ctx, entry.Owner, entry.Repo, opt)
+		if err != nil {
+			return fmt.Errorf("listing issues; page %d: %v", opt.ListOptions.Page, err)
+		}
+		if err := m.writeIssues(ctx, issues); err != nil {
+			return fmt.Errorf("writing issues; page %d: %v", opt.ListOptions.Page, err)
+		}
+		if resp.NextPage == 0 {
+			logger.Println("no more pages")
+			break
+		}
+		opt.ListOptions.Page = resp.NextPage
+	}
+
+	if err := saveState(store, syncState{Since: syncStart}); err != nil {
+		return fmt.Errorf("saving sync state: %v", err)
+	}
+
+	if committer, ok := store.(storage.Committer); ok {
+		message := fmt.Sprintf("sync %s/%s @ %s", entry.Owner, entry.Repo, syncStart.UTC().Format(time.RFC3339))
+		if err := committer.Commit(message); err != nil {
+			return fmt.Errorf("committing sync: %v", err)
+		}
+	}
+	return nil
+}
+
+// repoMirror carries the per-repository state writeIssues and its helpers
+// need, in place of the owner/repo/debug globals the single-repo binary
+// used to rely on.
+type repoMirror struct {
+	client  *github.Client
+	store   storage.Storage
+	owner   string
+	repo    string
+	logger  *Logger
+	metrics *Metrics
+
+	// inFlight bounds how many issues we process concurrently, so a
+	// large repo doesn't spawn thousands of simultaneous goroutines
+	// fighting over the same rate limit.
+	inFlight chan struct{}
+}
+
+func (m *repoMirror) writeIssues(ctx context.Context, issues []*github.Issue) error {
+	g, ctx := errgroup.WithContext(ctx)
+	m.logger.Printf("processing %d issues", len(issues))
+	for _, issue := range issues {
+		issueVal := *issue
+		num := *issueVal.Number
+		g.Go(func() error {
+			m.inFlight <- struct{}{}
+			defer func() { <-m.inFlight }()
+
+			start := time.Now()
+			m.logger.Printf("started processing %d at %v", num, start)
+
+			// Write the issue, unless GitHub hasn't reported it updated
+			// since our last successful sync. The bulk issue-list
+			// endpoint has no per-item ETag, so UpdatedAt stands in for
+			// one.
+			issueEtagKey := fmt.Sprintf("issues/%d", num)
+			rec := decodeETag(m.store.GetETag(issueEtagKey))
+			lastModified := ""
+			if issueVal.UpdatedAt != nil {
+				lastModified = issueVal.UpdatedAt.UTC().Format(http.TimeFormat)
+			}
+			if lastModified == "" || lastModified != rec.LastModified {
+				issueJSON, err := json.Marshal(issueVal)
+				if err != nil {
+					return err
+				}
+				if err := m.store.PutIssue(num, issueJSON); err != nil {
+					return err
+				}
+				m.metrics.IncIssuesSynced()
+				if lastModified != "" {
+					if err := m.store.PutETag(issueEtagKey, encodeETag(etagRecord{LastModified: lastModified})); err != nil {
+						return err
+					}
+				}
+			} else {
+				m.logger.Printf("issue %d unchanged since %s, skipping", num, lastModified)
+			}
+
+			// Pull requests carry more state than a plain issue: the PR
+			// object itself, reviews, review comments, commits, and
+			// requested reviewers.
+			if issueVal.PullRequestLinks != nil {
+				if err := m.writePullRequest(ctx, num); err != nil {
+					return fmt.Errorf("writing pull request %d: %v", num, err)
+				}
+			}
+
+			// Timeline events capture cross-references, label changes,
+			// and review requests in the order they happened.
+			if err := m.writeIssueTimeline(ctx, num); err != nil {
+				return fmt.Errorf("writing timeline for issue %d: %v", num, err)
+			}
+
+			// Are there comments?
+			if *issue.Comments <= 0 {
+				return nil
+			}
+
+			// OK, now handle the comments, using a conditional request
+			// on the first page so an unchanged comment list costs
+			// GitHub a cheap 304 instead of a full body.
+			commentsEtagKey := fmt.Sprintf("issues/%d/comments", num)
+			commentsRec := decodeETag(m.store.GetETag(commentsEtagKey))
+			opt := &github.IssueListCommentsOptions{
+				Sort:      "created",
+				Direction: "asc",
+				ListOptions: github.ListOptions{
+					Page:    0,
+					PerPage: 100,
+				},
+			}
+			for {
+				u := fmt.Sprintf("repos/%s/%s/issues/%d/comments?sort=%s&direction=%s&page=%d&per_page=%d",
+					m.owner, m.repo, num, opt.Sort, opt.Direction, opt.ListOptions.Page, opt.ListOptions.PerPage)
+				m.logger.Printf("GET %s", u)
+				req, err := m.client.NewRequest("GET", u, nil)
+				if err != nil {
+					return fmt.Errorf("building comments request for issue=%d; page %d: %v", num, opt.ListOptions.Page, err)
+				}
+				if opt.ListOptions.Page == 0 {
+					applyConditionalHeaders(req, commentsRec)
+				}
+				var comments []*github.IssueComment
+				resp, err := m.client.Do(ctx, req, &comments)
+				if err != nil && (resp == nil || resp.StatusCode != http.StatusNotModified) {
+					return fmt.Errorf("listing comments for issue=%d; page %d: %v", num, opt.ListOptions.Page, err)
+				}
+				if resp.StatusCode == http.StatusNotModified {
+					m.logger.Printf("comments for issue=%d not modified since %s, skipping", num, commentsRec.LastModified)
+					break
+				}
+				if err := m.writeComments(issueVal, comments); err != nil {
+					return fmt.Errorf("writing comments for issue=%d; page %d: %v", num, opt.ListOptions.Page, err)
+				}
+				if opt.ListOptions.Page == 0 {
+					if err := m.store.PutETag(commentsEtagKey, encodeETag(etagFromResponse(resp.Response))); err != nil {
+						return fmt.Errorf("saving comments etag for issue=%d: %v", num, err)
+					}
+				}
+				if resp.NextPage == 0 {
+					break
+				}
+				opt.ListOptions.Page = resp.NextPage
+			}
+			m.logger.Printf("finished processing %d in %s", num, time.Since(start))
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+func (m *repoMirror) writeComments(issue github.Issue, comments []*github.IssueComment) error {
+	g, _ := errgroup.WithContext(context.Background())
+	m.logger.Printf("processing %d comments for issue=%d", len(comments), *issue.Number)
+	for _, comment := range comments {
+		commentVal := *comment
+		g.Go(func() error {
+			commentJSON, err := json.Marshal(commentVal)
+			if err != nil {
+				return err
+			}
+			return m.store.PutComment(*issue.Number, *commentVal.ID, commentJSON)
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,176 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/go-github/github"
+	"github.com/parkr/jekyll-issue-mirror/storage"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Pull requests live alongside issues, but issuemirror.Root doesn't know
+// about them, so we lay out our own tree under the Storage backend:
+// pulls/<n>/pr.json, pulls/<n>/reviews/<id>.json,
+// pulls/<n>/review-comments/<id>.json, pulls/<n>/commits/<sha>.json, and
+// pulls/<n>/requested-reviewers.json.
+
+func pullDir(num int) string {
+	return filepath.Join("pulls", fmt.Sprintf("%d", num))
+}
+
+func pullJSONFile(num int) string {
+	return filepath.Join(pullDir(num), "pr.json")
+}
+
+func pullReviewFile(num int, id int64) string {
+	return filepath.Join(pullDir(num), "reviews", fmt.Sprintf("%d.json", id))
+}
+
+func pullReviewCommentFile(num int, id int64) string {
+	return filepath.Join(pullDir(num), "review-comments", fmt.Sprintf("%d.json", id))
+}
+
+func pullCommitFile(num int, sha string) string {
+	return filepath.Join(pullDir(num), "commits", fmt.Sprintf("%s.json", sha))
+}
+
+func pullRequestedReviewersFile(num int) string {
+	return filepath.Join(pullDir(num), "requested-reviewers.json")
+}
+
+func issueEventFile(num int, id int64) string {
+	return filepath.Join("issues", fmt.Sprintf("%d", num), "events", fmt.Sprintf("%d.json", id))
+}
+
+func writeJSON(store storage.Storage, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.PutFile(key, data)
+}
+
+// writePullRequest fetches and persists everything beyond the bare issue
+// for a pull request: the PR object itself, its reviews, review comments,
+// commits, and requested reviewers.
+func (m *repoMirror) writePullRequest(ctx context.Context, num int) error {
+	pr, _, err := m.client.PullRequests.Get(ctx, m.owner, m.repo, num)
+	if err != nil {
+		return fmt.Errorf("getting pull request %d: %v", num, err)
+	}
+	if err := writeJSON(m.store, pullJSONFile(num), pr); err != nil {
+		return fmt.Errorf("writing pull request %d: %v", num, err)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return paginate(func(opt github.ListOptions) (int, error) {
+			reviews, resp, err := m.client.PullRequests.ListReviews(ctx, m.owner, m.repo, num, &github.ListOptions{Page: opt.Page, PerPage: opt.PerPage})
+			if err != nil {
+				return 0, fmt.Errorf("listing reviews for pull=%d; page %d: %v", num, opt.Page, err)
+			}
+			for _, review := range reviews {
+				if err := writeJSON(m.store, pullReviewFile(num, *review.ID), review); err != nil {
+					return 0, err
+				}
+			}
+			return resp.NextPage, nil
+		})
+	})
+
+	g.Go(func() error {
+		return paginate(func(opt github.ListOptions) (int, error) {
+			comments, resp, err := m.client.PullRequests.ListComments(ctx, m.owner, m.repo, num, &github.PullRequestListCommentsOptions{ListOptions: opt})
+			if err != nil {
+				return 0, fmt.Errorf("listing review comments for pull=%d; page %d: %v", num, opt.Page, err)
+			}
+			for _, comment := range comments {
+				if err := writeJSON(m.store, pullReviewCommentFile(num, *comment.ID), comment); err != nil {
+					return 0, err
+				}
+			}
+			return resp.NextPage, nil
+		})
+	})
+
+	g.Go(func() error {
+		return paginate(func(opt github.ListOptions) (int, error) {
+			commits, resp, err := m.client.PullRequests.ListCommits(ctx, m.owner, m.repo, num, &opt)
+			if err != nil {
+				return 0, fmt.Errorf("listing commits for pull=%d; page %d: %v", num, opt.Page, err)
+			}
+			for _, commit := range commits {
+				if err := writeJSON(m.store, pullCommitFile(num, *commit.SHA), commit); err != nil {
+					return 0, err
+				}
+			}
+			return resp.NextPage, nil
+		})
+	})
+
+	g.Go(func() error {
+		reviewers, _, err := m.client.PullRequests.ListReviewers(ctx, m.owner, m.repo, num, nil)
+		if err != nil {
+			return fmt.Errorf("listing requested reviewers for pull=%d: %v", num, err)
+		}
+		return writeJSON(m.store, pullRequestedReviewersFile(num), reviewers)
+	})
+
+	return g.Wait()
+}
+
+// writeIssueTimeline persists the issue's timeline events, which is where
+// cross-references, label changes, and review requests show up in order.
+func (m *repoMirror) writeIssueTimeline(ctx context.Context, num int) error {
+	return paginate(func(opt github.ListOptions) (int, error) {
+		events, resp, err := m.client.Issues.ListIssueTimeline(ctx, m.owner, m.repo, num, &opt)
+		if err != nil {
+			return 0, fmt.Errorf("listing timeline for issue=%d; page %d: %v", num, opt.Page, err)
+		}
+		for _, event := range events {
+			if err := writeJSON(m.store, issueEventFile(num, *event.ID), event); err != nil {
+				return 0, err
+			}
+		}
+		return resp.NextPage, nil
+	})
+}
+
+// MirrorPullRequestExtras fetches and persists everything beyond the bare
+// issue for pull request num — the PR object, its reviews, review
+// comments, commits, and requested reviewers — using client, through
+// store. It's exported so fetch modes other than Mirror's own REST issue
+// loop (githubgql's GraphQL fetcher, for instance) can stay at parity
+// with it instead of silently dropping PR detail.
+func MirrorPullRequestExtras(ctx context.Context, client *github.Client, store storage.Storage, owner, repo string, num int) error {
+	m := &repoMirror{client: client, store: store, owner: owner, repo: repo, logger: &Logger{}}
+	return m.writePullRequest(ctx, num)
+}
+
+// MirrorIssueTimeline fetches and persists issue num's timeline events
+// using client, through store. See MirrorPullRequestExtras for why this
+// is exported.
+func MirrorIssueTimeline(ctx context.Context, client *github.Client, store storage.Storage, owner, repo string, num int) error {
+	m := &repoMirror{client: client, store: store, owner: owner, repo: repo, logger: &Logger{}}
+	return m.writeIssueTimeline(ctx, num)
+}
+
+// paginate drives fetch across pages until fetch reports no next page.
+// fetch returns the response's NextPage (0 once exhausted).
+func paginate(fetch func(opt github.ListOptions) (nextPage int, err error)) error {
+	opt := github.ListOptions{Page: 0, PerPage: 100}
+	for {
+		nextPage, err := fetch(opt)
+		if err != nil {
+			return err
+		}
+		if nextPage == 0 {
+			return nil
+		}
+		opt.Page = nextPage
+	}
+}
@@ -0,0 +1,45 @@
+package mirror
+
+import "testing"
+
+func TestPullPathHelpers(t *testing.T) {
+	const num = 17
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"pullJSONFile", pullJSONFile(num), "pulls/17/pr.json"},
+		{"pullReviewFile", pullReviewFile(num, 5), "pulls/17/reviews/5.json"},
+		{"pullReviewCommentFile", pullReviewCommentFile(num, 6), "pulls/17/review-comments/6.json"},
+		{"pullCommitFile", pullCommitFile(num, "abc123"), "pulls/17/commits/abc123.json"},
+		{"pullRequestedReviewersFile", pullRequestedReviewersFile(num), "pulls/17/requested-reviewers.json"},
+		{"issueEventFile", issueEventFile(num, 9), "issues/17/events/9.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	store := newFakeStorage()
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	if err := writeJSON(store, "some/key.json", payload{Name: "hi"}); err != nil {
+		t.Fatalf("writeJSON() error = %v", err)
+	}
+	data, err := store.GetFile("some/key.json")
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if got, want := string(data), `{"name":"hi"}`; got != want {
+		t.Errorf("stored data = %s, want %s", got, want)
+	}
+}
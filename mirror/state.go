@@ -0,0 +1,52 @@
+package mirror
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/parkr/jekyll-issue-mirror/storage"
+)
+
+// stateKey is where a mirror run's last successful sync time is kept, so
+// the next run can pass Since to IssueListByRepoOptions instead of
+// re-walking every issue. It lives in Storage, not directly on disk, so
+// an S3 or git-commit-snapshot backend keeps it exactly as durable as
+// the issues and comments it's bookkeeping for.
+const stateKey = "state.json"
+
+type syncState struct {
+	Since time.Time `json:"since"`
+}
+
+func loadState(store storage.Storage) syncState {
+	data, err := store.GetFile(stateKey)
+	if err != nil {
+		return syncState{}
+	}
+	var st syncState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return syncState{}
+	}
+	return st
+}
+
+func saveState(store storage.Storage, st syncState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return store.PutFile(stateKey, data)
+}
+
+// LoadState returns store's last successful sync time, or the zero time
+// if none has been recorded yet. It's exported so fetchers other than
+// Mirror's REST loop (githubgql's GraphQL fetcher, for instance) can
+// still sync incrementally.
+func LoadState(store storage.Storage) time.Time {
+	return loadState(store).Since
+}
+
+// SaveState records since as store's last successful sync time.
+func SaveState(store storage.Storage, since time.Time) error {
+	return saveState(store, syncState{Since: since})
+}
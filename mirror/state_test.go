@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeStorage is a minimal in-memory storage.Storage for exercising
+// state.go and pulls.go without touching disk.
+type fakeStorage struct {
+	files map[string][]byte
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{files: map[string][]byte{}}
+}
+
+func (f *fakeStorage) PutIssue(int, []byte) error                 { return nil }
+func (f *fakeStorage) PutComment(int, int64, []byte) error        { return nil }
+func (f *fakeStorage) DeleteIssue(int) error                      { return nil }
+func (f *fakeStorage) DeleteComment(int, int64) error              { return nil }
+func (f *fakeStorage) GetETag(string) string                      { return "" }
+func (f *fakeStorage) PutETag(string, string) error                { return nil }
+
+func (f *fakeStorage) GetFile(key string) ([]byte, error) {
+	data, ok := f.files[key]
+	if !ok {
+		return nil, fmt.Errorf("no such file: %s", key)
+	}
+	return data, nil
+}
+
+func (f *fakeStorage) PutFile(key string, data []byte) error {
+	f.files[key] = data
+	return nil
+}
+
+func TestLoadStateWithNothingSaved(t *testing.T) {
+	if got := LoadState(newFakeStorage()); !got.IsZero() {
+		t.Errorf("LoadState() with nothing saved = %v, want the zero time", got)
+	}
+}
+
+func TestSaveStateThenLoadState(t *testing.T) {
+	store := newFakeStorage()
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := SaveState(store, since); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+	got := LoadState(store)
+	if !got.Equal(since) {
+		t.Errorf("LoadState() = %v, want %v", got, since)
+	}
+}
+
+func TestLoadStateWithCorruptFile(t *testing.T) {
+	store := newFakeStorage()
+	if err := store.PutFile(stateKey, []byte("not json")); err != nil {
+		t.Fatalf("PutFile() error = %v", err)
+	}
+	if got := LoadState(store); !got.IsZero() {
+		t.Errorf("LoadState() with a corrupt file = %v, want the zero time", got)
+	}
+}
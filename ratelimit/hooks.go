@@ -0,0 +1,27 @@
+package ratelimit
+
+// Hooks lets a caller observe a Transport's traffic without coupling
+// this package to whatever's collecting the numbers. The zero value
+// does nothing, so passing an empty Hooks is always safe.
+type Hooks struct {
+	// OnRequest is called once per HTTP round trip attempt, including
+	// retries.
+	OnRequest func()
+
+	// OnRateLimit is called once per round trip, after retries, if the
+	// final response carries rate-limit headers, with its
+	// X-RateLimit-Remaining value.
+	OnRateLimit func(remaining int)
+}
+
+func (h Hooks) onRequest() {
+	if h.OnRequest != nil {
+		h.OnRequest()
+	}
+}
+
+func (h Hooks) onRateLimit(remaining int) {
+	if h.OnRateLimit != nil {
+		h.OnRateLimit(remaining)
+	}
+}
@@ -0,0 +1,129 @@
+// Package ratelimit provides an http.RoundTripper that backs off before
+// GitHub's primary rate limit or secondary abuse detection kicks in,
+// instead of letting requests fail once the budget runs out.
+package ratelimit
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultThreshold is how many requests we keep in reserve; once
+	// X-RateLimit-Remaining drops below this we sleep until the window
+	// resets.
+	defaultThreshold = 100
+
+	maxRetries   = 5
+	initialDelay = time.Second
+)
+
+// Transport wraps Base, sleeping and retrying 403/429 abuse-detection
+// responses so callers rarely see them; a response still throttled after
+// maxRetries attempts is returned to the caller as is.
+type Transport struct {
+	Base http.RoundTripper
+
+	// Threshold is the X-RateLimit-Remaining floor below which we sleep
+	// until X-RateLimit-Reset. Zero means defaultThreshold.
+	Threshold int
+
+	// Hooks, if set, is notified of requests and rate-limit headers as
+	// they're observed. Useful for exposing Prometheus counters.
+	Hooks Hooks
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) threshold() int {
+	if t.Threshold > 0 {
+		return t.Threshold
+	}
+	return defaultThreshold
+}
+
+// RoundTrip retries 403/429 responses with exponential backoff and
+// jitter (honoring Retry-After when GitHub sends one), up to maxRetries
+// attempts in all, and then, if the final response reports that we're
+// running low on remaining requests, sleeps until the rate limit window
+// resets.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := initialDelay
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		t.Hooks.onRequest()
+		resp, err = t.base().RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		if !isThrottled(resp) || attempt >= maxRetries-1 {
+			break
+		}
+		wait := retryAfter(resp)
+		if wait == 0 {
+			wait = delay + jitter(delay)
+			delay *= 2
+		}
+		resp.Body.Close()
+		time.Sleep(wait)
+	}
+
+	if remaining, reset, ok := rateLimit(resp); ok {
+		t.Hooks.onRateLimit(remaining)
+		if remaining < t.threshold() {
+			time.Sleep(time.Until(reset))
+		}
+	}
+	return resp, err
+}
+
+func isThrottled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter returns the delay GitHub asked for via the Retry-After
+// header, or zero if it didn't send one.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func rateLimit(resp *http.Response) (remaining int, reset time.Time, ok bool) {
+	if resp == nil {
+		return 0, time.Time{}, false
+	}
+	remainingHeader := resp.Header.Get("X-RateLimit-Remaining")
+	resetHeader := resp.Header.Get("X-RateLimit-Reset")
+	if remainingHeader == "" || resetHeader == "" {
+		return 0, time.Time{}, false
+	}
+	remaining, err := strconv.Atoi(remainingHeader)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	resetUnix, err := strconv.ParseInt(resetHeader, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return remaining, time.Unix(resetUnix, 0), true
+}
+
+// jitter returns a random duration in [0, d) to avoid every goroutine
+// waking up and retrying in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
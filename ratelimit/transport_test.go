@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeRoundTripper returns responses[i] (or the last one, once exhausted)
+// on its i'th call, so a test can script a sequence of rate-limit
+// responses without hitting the network.
+type fakeRoundTripper struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (f *fakeRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	i := f.calls
+	if i >= len(f.responses) {
+		i = len(f.responses) - 1
+	}
+	f.calls++
+	return f.responses[i], nil
+}
+
+func throttledResponse(retryAfter string) *http.Response {
+	header := http.Header{}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     header,
+		Body:       ioutil.NopCloser(http.NoBody),
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"absent", "", 0},
+		{"zero", "0", 0},
+		{"negative", "-5", 0},
+		{"not a number", "soon", 0},
+		{"thirty seconds", "30", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			if got := retryAfter(resp); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	if _, _, ok := rateLimit(nil); ok {
+		t.Errorf("rateLimit(nil) reported ok")
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	if _, _, ok := rateLimit(resp); ok {
+		t.Errorf("rateLimit() with no headers reported ok")
+	}
+
+	resetAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	resp.Header.Set("X-RateLimit-Remaining", "42")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+	remaining, reset, ok := rateLimit(resp)
+	if !ok {
+		t.Fatalf("rateLimit() with both headers did not report ok")
+	}
+	if remaining != 42 {
+		t.Errorf("remaining = %d, want 42", remaining)
+	}
+	if !reset.Equal(resetAt) {
+		t.Errorf("reset = %v, want %v", reset, resetAt)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Errorf("jitter(0) = %v, want 0", got)
+	}
+	for i := 0; i < 100; i++ {
+		if got := jitter(time.Second); got < 0 || got >= time.Second {
+			t.Fatalf("jitter(1s) = %v, want in [0, 1s)", got)
+		}
+	}
+}
+
+func TestTransport_RoundTrip_StopsAtMaxRetries(t *testing.T) {
+	base := &fakeRoundTripper{responses: []*http.Response{throttledResponse("1")}}
+	var requests int
+	tr := &Transport{
+		Base:  base,
+		Hooks: Hooks{OnRequest: func() { requests++ }},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("final status = %d, want %d (still throttled after exhausting retries)", resp.StatusCode, http.StatusForbidden)
+	}
+	if requests != maxRetries {
+		t.Errorf("made %d requests, want %d (maxRetries)", requests, maxRetries)
+	}
+}
+
+func TestTransport_RoundTrip_RecoversAfterThrottle(t *testing.T) {
+	ok := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(http.NoBody),
+	}
+	base := &fakeRoundTripper{responses: []*http.Response{throttledResponse("0"), ok}}
+	tr := &Transport{Base: base}
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if base.calls != 2 {
+		t.Errorf("made %d requests, want 2 (one throttled, one that succeeded)", base.calls)
+	}
+}
+
+func TestTransport_RoundTrip_SleepsUntilResetWhenLow(t *testing.T) {
+	ok := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(http.NoBody),
+	}
+	ok.Header.Set("X-RateLimit-Remaining", "1")
+	ok.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+	base := &fakeRoundTripper{responses: []*http.Response{ok}}
+	var gotRemaining int
+	tr := &Transport{
+		Base:      base,
+		Threshold: 10,
+		Hooks:     Hooks{OnRateLimit: func(remaining int) { gotRemaining = remaining }},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	start := time.Now()
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RoundTrip() took %v, want well under a second (reset is already in the past)", elapsed)
+	}
+	if gotRemaining != 1 {
+		t.Errorf("OnRateLimit got remaining=%d, want 1", gotRemaining)
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusForbidden, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status}
+		if got := isThrottled(resp); got != tt.want {
+			t.Errorf("isThrottled(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
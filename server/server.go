@@ -0,0 +1,236 @@
+// Package server exposes a mirrored repository over HTTP: the issues and
+// comments already on disk as JSON, Prometheus-style counters, and a
+// webhook endpoint that lets GitHub push updates in between polls
+// instead of waiting for the next one. It's the same poll-plus-serve
+// shape as golang.org/x/build's gitmirror.
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bradfitz/issuemirror"
+	"github.com/google/go-github/github"
+	"github.com/parkr/jekyll-issue-mirror/mirror"
+	"github.com/parkr/jekyll-issue-mirror/storage"
+)
+
+// Server serves a single mirrored repository's issues over HTTP and
+// accepts GitHub webhooks to keep it fresh between polls.
+type Server struct {
+	Root issuemirror.Root
+
+	// Store is where webhook-driven issue and comment updates are
+	// written, so they land wherever the rest of a mirror run does
+	// (filesystem, S3, or a git-commit snapshot) instead of always
+	// hitting Root's filesystem directly. It's required for
+	// handleWebhook; the read-only /issues/ endpoints still serve
+	// straight from Root.
+	Store storage.Storage
+
+	// WebhookSecret validates the X-Hub-Signature-256 header GitHub
+	// sends with each webhook delivery. Empty disables validation,
+	// which is only safe behind something else that restricts access.
+	WebhookSecret string
+
+	// Metrics is optional; if set, it's updated as issues arrive and
+	// reported on /metrics. Comment deliveries don't update it.
+	Metrics *mirror.Metrics
+}
+
+// Handler returns the mux serving /issues/, /healthz, /metrics, and
+// /webhook.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/webhook", s.handleWebhook)
+	mux.HandleFunc("/issues/", s.handleIssue)
+	return mux
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP issues_synced_total Issues written to storage.\n")
+	fmt.Fprintf(w, "# TYPE issues_synced_total counter\n")
+	fmt.Fprintf(w, "issues_synced_total %d\n", s.Metrics.IssuesSynced())
+	fmt.Fprintf(w, "# HELP api_calls_total GitHub API requests made.\n")
+	fmt.Fprintf(w, "# TYPE api_calls_total counter\n")
+	fmt.Fprintf(w, "api_calls_total %d\n", s.Metrics.APICalls())
+	fmt.Fprintf(w, "# HELP rate_limit_remaining GitHub requests left in the current window.\n")
+	fmt.Fprintf(w, "# TYPE rate_limit_remaining gauge\n")
+	fmt.Fprintf(w, "rate_limit_remaining %d\n", s.Metrics.RateLimitRemaining())
+}
+
+// handleIssue serves /issues/<n> and /issues/<n>/comments straight from
+// the files the mirror already wrote to Root.
+func (s *Server) handleIssue(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/issues/"), "/")
+	parts := strings.SplitN(path, "/", 2)
+	num, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "comments" {
+		s.serveComments(w, r, num)
+		return
+	}
+	s.serveFile(w, r, s.Root.IssueJSONFile(num))
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// serveComments reads every comment file for issue num and writes them
+// out as a single JSON array, the shape callers expect from a listing
+// endpoint.
+func (s *Server) serveComments(w http.ResponseWriter, r *http.Request, num int) {
+	dir := s.Root.IssueCommentsDir(num)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("["))
+	wrote := false
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if wrote {
+			w.Write([]byte(","))
+		}
+		w.Write(data)
+		wrote = true
+	}
+	w.Write([]byte("]"))
+}
+
+// handleWebhook accepts GitHub's "issues" and "issue_comment" events and
+// writes the payload straight to Store, bypassing the API entirely. It
+// gives near-real-time mirroring between the periodic polls Mirror
+// already does.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.WebhookSecret != "" && !validSignature(s.WebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var err2 error
+	switch r.Header.Get("X-GitHub-Event") {
+	case "issues":
+		err2 = s.handleIssuesEvent(body)
+	case "issue_comment":
+		err2 = s.handleIssueCommentEvent(body)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err2 != nil {
+		http.Error(w, err2.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIssuesEvent upserts the issue through Store for every action
+// except "deleted", which removes it instead — otherwise a deleted issue
+// would be rewritten with its last-known body forever.
+func (s *Server) handleIssuesEvent(body []byte) error {
+	var payload struct {
+		Action string        `json:"action"`
+		Issue  *github.Issue `json:"issue"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("decoding issues event: %v", err)
+	}
+	if payload.Issue == nil || payload.Issue.Number == nil {
+		return fmt.Errorf("issues event missing issue number")
+	}
+	num := *payload.Issue.Number
+	if payload.Action == "deleted" {
+		return s.Store.DeleteIssue(num)
+	}
+	data, err := json.Marshal(payload.Issue)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.PutIssue(num, data); err != nil {
+		return err
+	}
+	s.Metrics.IncIssuesSynced()
+	return nil
+}
+
+// handleIssueCommentEvent upserts the comment through Store for every
+// action except "deleted", which removes it instead — see
+// handleIssuesEvent.
+func (s *Server) handleIssueCommentEvent(body []byte) error {
+	var payload struct {
+		Action  string               `json:"action"`
+		Issue   *github.Issue        `json:"issue"`
+		Comment *github.IssueComment `json:"comment"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("decoding issue_comment event: %v", err)
+	}
+	if payload.Issue == nil || payload.Issue.Number == nil || payload.Comment == nil || payload.Comment.ID == nil {
+		return fmt.Errorf("issue_comment event missing issue or comment id")
+	}
+	num, commentID := *payload.Issue.Number, *payload.Comment.ID
+	if payload.Action == "deleted" {
+		return s.Store.DeleteComment(num, commentID)
+	}
+	data, err := json.Marshal(payload.Comment)
+	if err != nil {
+		return err
+	}
+	return s.Store.PutComment(num, commentID, data)
+}
+
+// validSignature checks body against the sha256= signature GitHub sends
+// in X-Hub-Signature-256.
+func validSignature(secret string, body []byte, header string) bool {
+	const prefix = "sha256="
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
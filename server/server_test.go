@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parkr/jekyll-issue-mirror/mirror"
+)
+
+// fakeStorage is an in-memory storage.Storage for exercising the webhook
+// handlers without touching disk.
+type fakeStorage struct {
+	issues   map[int][]byte
+	comments map[string][]byte
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{issues: map[int][]byte{}, comments: map[string][]byte{}}
+}
+
+func commentKey(issueNum int, commentID int64) string {
+	return fmt.Sprintf("%d/%d", issueNum, commentID)
+}
+
+func (f *fakeStorage) PutIssue(num int, data []byte) error {
+	f.issues[num] = data
+	return nil
+}
+
+func (f *fakeStorage) PutComment(issueNum int, commentID int64, data []byte) error {
+	f.comments[commentKey(issueNum, commentID)] = data
+	return nil
+}
+
+func (f *fakeStorage) DeleteIssue(num int) error {
+	delete(f.issues, num)
+	return nil
+}
+
+func (f *fakeStorage) DeleteComment(issueNum int, commentID int64) error {
+	delete(f.comments, commentKey(issueNum, commentID))
+	return nil
+}
+
+func (f *fakeStorage) GetETag(string) string         { return "" }
+func (f *fakeStorage) PutETag(string, string) error  { return nil }
+func (f *fakeStorage) GetFile(string) ([]byte, error) { return nil, fmt.Errorf("not found") }
+func (f *fakeStorage) PutFile(string, []byte) error   { return nil }
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	const secret = "shh"
+	body := []byte(`{"action":"created"}`)
+
+	if !validSignature(secret, body, sign(secret, body)) {
+		t.Errorf("valid signature rejected")
+	}
+	if validSignature(secret, body, sign("wrong-secret", body)) {
+		t.Errorf("signature from the wrong secret accepted")
+	}
+	if validSignature(secret, []byte(`{"action":"deleted"}`), sign(secret, body)) {
+		t.Errorf("signature for a different body accepted")
+	}
+	if validSignature(secret, body, "") {
+		t.Errorf("missing header accepted")
+	}
+	if validSignature(secret, body, "sha1="+hex.EncodeToString([]byte("nope"))) {
+		t.Errorf("wrong-prefix header accepted")
+	}
+	if validSignature(secret, body, "sha256=not-hex") {
+		t.Errorf("non-hex header accepted")
+	}
+}
+
+func postWebhook(t *testing.T, srv *Server, event string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshaling payload: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	w := httptest.NewRecorder()
+	srv.handleWebhook(w, req)
+	return w
+}
+
+func TestHandleWebhook_IssuesUpsertAndDelete(t *testing.T) {
+	store := newFakeStorage()
+	srv := &Server{Store: store, Metrics: &mirror.Metrics{}}
+
+	num := 42
+	w := postWebhook(t, srv, "issues", map[string]interface{}{
+		"action": "opened",
+		"issue":  map[string]interface{}{"number": num, "title": "hello"},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("opened: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, ok := store.issues[num]; !ok {
+		t.Fatalf("opened: issue %d not written to storage", num)
+	}
+	if got := store.issues[num]; !bytes.Contains(got, []byte("hello")) {
+		t.Errorf("opened: stored issue = %s, want it to contain the title", got)
+	}
+	if synced := srv.Metrics.IssuesSynced(); synced != 1 {
+		t.Errorf("opened: IssuesSynced() = %d, want 1", synced)
+	}
+
+	w = postWebhook(t, srv, "issues", map[string]interface{}{
+		"action": "deleted",
+		"issue":  map[string]interface{}{"number": num},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("deleted: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, ok := store.issues[num]; ok {
+		t.Errorf("deleted: issue %d still in storage", num)
+	}
+}
+
+func TestHandleWebhook_IssueCommentUpsertAndDelete(t *testing.T) {
+	store := newFakeStorage()
+	srv := &Server{Store: store, Metrics: &mirror.Metrics{}}
+
+	issueNum, commentID := 7, int64(99)
+	w := postWebhook(t, srv, "issue_comment", map[string]interface{}{
+		"action":  "created",
+		"issue":   map[string]interface{}{"number": issueNum},
+		"comment": map[string]interface{}{"id": commentID, "body": "hi"},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("created: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	key := commentKey(issueNum, commentID)
+	if _, ok := store.comments[key]; !ok {
+		t.Fatalf("created: comment %s not written to storage", key)
+	}
+
+	w = postWebhook(t, srv, "issue_comment", map[string]interface{}{
+		"action":  "deleted",
+		"issue":   map[string]interface{}{"number": issueNum},
+		"comment": map[string]interface{}{"id": commentID},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("deleted: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, ok := store.comments[key]; ok {
+		t.Errorf("deleted: comment %s still in storage", key)
+	}
+}
+
+func TestHandleWebhook_UnknownEventAccepted(t *testing.T) {
+	srv := &Server{Store: newFakeStorage(), Metrics: &mirror.Metrics{}}
+	w := postWebhook(t, srv, "ping", map[string]interface{}{"zen": "hi"})
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestHandleWebhook_InvalidSignatureRejected(t *testing.T) {
+	srv := &Server{Store: newFakeStorage(), Metrics: &mirror.Metrics{}, WebhookSecret: "shh"}
+	body := []byte(`{"action":"opened","issue":{"number":1}}`)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "issues")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString([]byte("bogus")))
+	w := httptest.NewRecorder()
+	srv.handleWebhook(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
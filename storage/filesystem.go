@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bradfitz/issuemirror"
+)
+
+// Filesystem is the original storage backend: everything lands in a
+// directory tree laid out by issuemirror.Root.
+type Filesystem struct {
+	Root issuemirror.Root
+}
+
+// NewFilesystem returns a Storage that writes under root.
+func NewFilesystem(root issuemirror.Root) *Filesystem {
+	return &Filesystem{Root: root}
+}
+
+func (f *Filesystem) PutIssue(num int, data []byte) error {
+	path := f.Root.IssueJSONFile(num)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (f *Filesystem) PutComment(issueNum int, commentID int64, data []byte) error {
+	if err := os.MkdirAll(f.Root.IssueCommentsDir(issueNum), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Root.IssueCommentFile(issueNum, commentID), data, 0644)
+}
+
+// DeleteIssue removes num's JSON file, treating its absence as success.
+func (f *Filesystem) DeleteIssue(num int) error {
+	return removeFile(f.Root.IssueJSONFile(num))
+}
+
+// DeleteComment removes commentID's JSON file, treating its absence as
+// success.
+func (f *Filesystem) DeleteComment(issueNum int, commentID int64) error {
+	return removeFile(f.Root.IssueCommentFile(issueNum, commentID))
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *Filesystem) etagFile(key string) string {
+	return filepath.Join(string(f.Root), "etags", key+".json")
+}
+
+func (f *Filesystem) GetFile(key string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(f.Root), key))
+}
+
+func (f *Filesystem) PutFile(key string, data []byte) error {
+	path := filepath.Join(string(f.Root), key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (f *Filesystem) GetETag(key string) string {
+	data, err := ioutil.ReadFile(f.etagFile(key))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (f *Filesystem) PutETag(key string, etag string) error {
+	path := f.etagFile(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(etag), 0644)
+}
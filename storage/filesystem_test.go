@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradfitz/issuemirror"
+)
+
+func newTestFilesystem(t *testing.T) (*Filesystem, issuemirror.Root) {
+	t.Helper()
+	root := issuemirror.Root(t.TempDir())
+	return NewFilesystem(root), root
+}
+
+func TestFilesystem_PutIssueThenDeleteIssue(t *testing.T) {
+	fs, root := newTestFilesystem(t)
+	const num = 1
+
+	if err := fs.PutIssue(num, []byte(`{"number":1}`)); err != nil {
+		t.Fatalf("PutIssue() error = %v", err)
+	}
+	if _, err := os.Stat(root.IssueJSONFile(num)); err != nil {
+		t.Fatalf("issue file missing after PutIssue(): %v", err)
+	}
+
+	if err := fs.DeleteIssue(num); err != nil {
+		t.Fatalf("DeleteIssue() error = %v", err)
+	}
+	if _, err := os.Stat(root.IssueJSONFile(num)); !os.IsNotExist(err) {
+		t.Errorf("issue file still present after DeleteIssue(): err = %v", err)
+	}
+
+	// Deleting an already-absent issue is success, not an error.
+	if err := fs.DeleteIssue(num); err != nil {
+		t.Errorf("DeleteIssue() on an absent issue returned an error: %v", err)
+	}
+}
+
+func TestFilesystem_PutCommentThenDeleteComment(t *testing.T) {
+	fs, root := newTestFilesystem(t)
+	const issueNum, commentID = 2, int64(3)
+
+	if err := fs.PutComment(issueNum, commentID, []byte(`{"id":3}`)); err != nil {
+		t.Fatalf("PutComment() error = %v", err)
+	}
+	if _, err := os.Stat(root.IssueCommentFile(issueNum, commentID)); err != nil {
+		t.Fatalf("comment file missing after PutComment(): %v", err)
+	}
+
+	if err := fs.DeleteComment(issueNum, commentID); err != nil {
+		t.Fatalf("DeleteComment() error = %v", err)
+	}
+	if _, err := os.Stat(root.IssueCommentFile(issueNum, commentID)); !os.IsNotExist(err) {
+		t.Errorf("comment file still present after DeleteComment(): err = %v", err)
+	}
+}
+
+func TestFilesystem_GetFileMissing(t *testing.T) {
+	fs, _ := newTestFilesystem(t)
+	if _, err := fs.GetFile("nonexistent.json"); err == nil {
+		t.Errorf("GetFile() on a missing key returned no error")
+	}
+}
+
+func TestFilesystem_PutFileThenGetFile(t *testing.T) {
+	fs, root := newTestFilesystem(t)
+	key := filepath.Join("nested", "dir", "state.json")
+	data := []byte(`{"since":"2026-01-01T00:00:00Z"}`)
+
+	if err := fs.PutFile(key, data); err != nil {
+		t.Fatalf("PutFile() error = %v", err)
+	}
+	got, err := fs.GetFile(key)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("GetFile() = %s, want %s", got, data)
+	}
+	if _, err := os.Stat(filepath.Join(string(root), key)); err != nil {
+		t.Errorf("PutFile() didn't create %s: %v", key, err)
+	}
+}
+
+func TestFilesystem_ETagRoundTrip(t *testing.T) {
+	fs, _ := newTestFilesystem(t)
+
+	if got := fs.GetETag("issues/1"); got != "" {
+		t.Errorf("GetETag() with nothing saved = %q, want empty", got)
+	}
+
+	const etag = `{"etag":"\"abc\""}`
+	if err := fs.PutETag("issues/1", etag); err != nil {
+		t.Fatalf("PutETag() error = %v", err)
+	}
+	if got := fs.GetETag("issues/1"); got != etag {
+		t.Errorf("GetETag() = %q, want %q", got, etag)
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// Git wraps a Filesystem backend and commits each run's changes to a
+// local git repository, the same pattern golang.org/x/build's gitmirror
+// uses: the mirror itself becomes an auditable, diffable history instead
+// of a silent overwrite.
+type Git struct {
+	*Filesystem
+	Dir string // the git working tree, normally Filesystem.Root's path
+}
+
+// NewGit returns a Storage that writes through fs and commits dir when
+// Commit is called.
+func NewGit(fs *Filesystem, dir string) *Git {
+	return &Git{Filesystem: fs, Dir: dir}
+}
+
+// Commit stages and commits every change under Dir with message. It's a
+// no-op, not an error, if there's nothing staged.
+func (g *Git) Commit(message string) error {
+	if err := g.run("add", "-A"); err != nil {
+		return err
+	}
+	if err := g.run("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	return g.run("commit", "-m", message)
+}
+
+func (g *Git) run(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %v: %v: %s", args, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bradfitz/issuemirror"
+)
+
+// Config selects and configures a Storage backend.
+type Config struct {
+	Type   string // "filesystem" (default), "s3", or "git"
+	Bucket string // S3 only
+	Prefix string // S3 only
+	Region string // S3 only
+}
+
+// New builds the Storage backend described by cfg. root lays out the
+// issue/comment tree; dir is the local directory backing the filesystem
+// and git backends (normally the same path as root).
+func New(cfg Config, root issuemirror.Root, dir string) (Storage, error) {
+	switch cfg.Type {
+	case "", "filesystem":
+		return NewFilesystem(root), nil
+	case "git":
+		return NewGit(NewFilesystem(root), dir), nil
+	case "s3":
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(cfg.Region)})
+		if err != nil {
+			return nil, fmt.Errorf("creating S3 session: %v", err)
+		}
+		return &S3{Client: s3.New(sess), Bucket: cfg.Bucket, Prefix: cfg.Prefix}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/bradfitz/issuemirror"
+)
+
+func TestNew_DefaultsToFilesystem(t *testing.T) {
+	root := issuemirror.Root(t.TempDir())
+
+	for _, typ := range []string{"", "filesystem"} {
+		store, err := New(Config{Type: typ}, root, string(root))
+		if err != nil {
+			t.Fatalf("New(Type: %q) error = %v", typ, err)
+		}
+		if _, ok := store.(*Filesystem); !ok {
+			t.Errorf("New(Type: %q) = %T, want *Filesystem", typ, store)
+		}
+	}
+}
+
+func TestNew_Git(t *testing.T) {
+	root := issuemirror.Root(t.TempDir())
+	store, err := New(Config{Type: "git"}, root, string(root))
+	if err != nil {
+		t.Fatalf("New(Type: \"git\") error = %v", err)
+	}
+	if _, ok := store.(*Git); !ok {
+		t.Errorf("New(Type: \"git\") = %T, want *Git", store)
+	}
+}
+
+func TestNew_UnknownType(t *testing.T) {
+	root := issuemirror.Root(t.TempDir())
+	if _, err := New(Config{Type: "carrier-pigeon"}, root, string(root)); err == nil {
+		t.Errorf("New() with an unknown type returned no error")
+	}
+}
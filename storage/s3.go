@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3 publishes a mirror run straight to a bucket, which is handy for
+// CI-driven mirrors that just need to land somewhere durable and
+// shareable rather than on the runner's own disk.
+type S3 struct {
+	Client *s3.S3
+	Bucket string
+	Prefix string
+}
+
+func (s *S3) key(parts ...string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(s.Prefix, "/")+"/"+strings.Join(parts, "/"), "/")
+}
+
+func (s *S3) put(key string, data []byte) error {
+	_, err := s.Client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *S3) PutIssue(num int, data []byte) error {
+	return s.put(s.key("issues", fmt.Sprintf("%d.json", num)), data)
+}
+
+func (s *S3) PutComment(issueNum int, commentID int64, data []byte) error {
+	return s.put(s.key("issues", fmt.Sprintf("%d", issueNum), "comments", fmt.Sprintf("%d.json", commentID)), data)
+}
+
+func (s *S3) delete(key string) error {
+	_, err := s.Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// DeleteIssue removes num's object, treating its absence as success —
+// S3's DeleteObject already does.
+func (s *S3) DeleteIssue(num int) error {
+	return s.delete(s.key("issues", fmt.Sprintf("%d.json", num)))
+}
+
+// DeleteComment removes commentID's object, treating its absence as
+// success.
+func (s *S3) DeleteComment(issueNum int, commentID int64) error {
+	return s.delete(s.key("issues", fmt.Sprintf("%d", issueNum), "comments", fmt.Sprintf("%d.json", commentID)))
+}
+
+func (s *S3) GetETag(key string) string {
+	out, err := s.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key("etags", key+".json")),
+	})
+	if err != nil {
+		return ""
+	}
+	defer out.Body.Close()
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (s *S3) PutETag(key string, etag string) error {
+	return s.put(s.key("etags", key+".json"), []byte(etag))
+}
+
+func (s *S3) GetFile(key string) ([]byte, error) {
+	out, err := s.Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+func (s *S3) PutFile(key string, data []byte) error {
+	return s.put(s.key(key), data)
+}
@@ -0,0 +1,33 @@
+// Package storage abstracts the write side of a mirror run, so the same
+// sync logic can land on a local filesystem, an S3 bucket, or a
+// versioned git repository instead of being hardwired to ioutil.WriteFile.
+package storage
+
+// Storage is where a mirror run's issues, comments, and conditional-
+// request bookkeeping end up.
+type Storage interface {
+	PutIssue(num int, data []byte) error
+	PutComment(issueNum int, commentID int64, data []byte) error
+
+	// DeleteIssue and DeleteComment remove a previously mirrored issue or
+	// comment, for webhook deliveries whose action is "deleted" — both
+	// treat an already-absent entry as success.
+	DeleteIssue(num int) error
+	DeleteComment(issueNum int, commentID int64) error
+
+	GetETag(key string) string
+	PutETag(key string, etag string) error
+
+	// GetFile and PutFile cover everything else a mirror run persists
+	// that isn't an issue, a comment, or an etag: pull request detail,
+	// timeline events, and sync state. key is a slash-separated path
+	// relative to the backend's root.
+	GetFile(key string) ([]byte, error)
+	PutFile(key string, data []byte) error
+}
+
+// Committer is implemented by backends, like Git, that need to be told
+// explicitly when a run has finished so they can snapshot it.
+type Committer interface {
+	Commit(message string) error
+}